@@ -2,8 +2,11 @@ package metrics
 
 // Config contains metrics configuration
 type Config struct {
-	Log          bool
-	LogInterval  int
+	Log         bool
+	LogInterval int
+	// LogFormatter is either empty (default line format) or
+	// FormatterPrometheus to emit the Prometheus text exposition format
+	// on every log tick.
 	LogFormatter string
 	HTTP         string
 	Host         string
@@ -0,0 +1,13 @@
+package metrics
+
+import "net/http"
+
+// Handler returns an http.Handler suitable for mounting at a scrape
+// path (e.g. "/metrics") that serializes all registered metrics in the
+// Prometheus text exposition format.
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WritePrometheus(w)
+	})
+}
@@ -0,0 +1,237 @@
+package metrics
+
+import "sync"
+
+// Counter is a simple monotonically increasing metric, safe for
+// concurrent use.
+type Counter struct {
+	name string
+	mu   sync.Mutex
+	val  int64
+}
+
+// Name returns the counter's registered name.
+func (c *Counter) Name() string {
+	return c.name
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add increments the counter by delta.
+func (c *Counter) Add(delta int64) {
+	c.mu.Lock()
+	c.val += delta
+	c.mu.Unlock()
+}
+
+// Value returns the counter's current value.
+func (c *Counter) Value() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.val
+}
+
+// Gauge is a metric that can go up and down, e.g. a current queue size.
+type Gauge struct {
+	name string
+	mu   sync.Mutex
+	val  float64
+}
+
+// Name returns the gauge's registered name.
+func (g *Gauge) Name() string {
+	return g.name
+}
+
+// Set updates the gauge's current value.
+func (g *Gauge) Set(v float64) {
+	g.mu.Lock()
+	g.val = v
+	g.mu.Unlock()
+}
+
+// Value returns the gauge's current value.
+func (g *Gauge) Value() float64 {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.val
+}
+
+// GaugeFunc is a gauge whose value is computed on demand (e.g. from
+// runtime stats) instead of being set explicitly.
+type GaugeFunc struct {
+	name string
+	fn   func() float64
+}
+
+// Name returns the gauge func's registered name.
+func (g *GaugeFunc) Name() string {
+	return g.name
+}
+
+// Value invokes the underlying function and returns its result.
+func (g *GaugeFunc) Value() float64 {
+	return g.fn()
+}
+
+// Histogram tracks the distribution of observed values across a fixed
+// set of upper-bound buckets, in the same shape Prometheus expects.
+type Histogram struct {
+	name    string
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []int64
+	sum    float64
+	count  int64
+}
+
+// Name returns the histogram's registered name.
+func (h *Histogram) Name() string {
+	return h.name
+}
+
+// Observe records a single value.
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.sum += v
+	h.count++
+
+	for i, upperBound := range h.buckets {
+		if v <= upperBound {
+			h.counts[i]++
+		}
+	}
+}
+
+// Snapshot returns the histogram's buckets (cumulative counts), sum and
+// total count.
+func (h *Histogram) Snapshot() (buckets []float64, counts []int64, sum float64, count int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets = append(buckets, h.buckets...)
+	counts = append(counts, h.counts...)
+	return buckets, counts, h.sum, h.count
+}
+
+var (
+	registryMu sync.Mutex
+	counters   = make(map[string]*Counter)
+	gauges     = make(map[string]*Gauge)
+	gaugeFuncs = make(map[string]*GaugeFunc)
+	histograms = make(map[string]*Histogram)
+)
+
+// RegisterCounter returns the counter registered under name, creating it
+// on first use. Safe to call from package-level vars across packages.
+func RegisterCounter(name string) *Counter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if c, ok := counters[name]; ok {
+		return c
+	}
+
+	c := &Counter{name: name}
+	counters[name] = c
+	return c
+}
+
+// Counters returns a snapshot of all registered counters.
+func Counters() []*Counter {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	result := make([]*Counter, 0, len(counters))
+	for _, c := range counters {
+		result = append(result, c)
+	}
+	return result
+}
+
+// RegisterGauge returns the gauge registered under name, creating it on
+// first use.
+func RegisterGauge(name string) *Gauge {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if g, ok := gauges[name]; ok {
+		return g
+	}
+
+	g := &Gauge{name: name}
+	gauges[name] = g
+	return g
+}
+
+// Gauges returns a snapshot of all registered gauges.
+func Gauges() []*Gauge {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	result := make([]*Gauge, 0, len(gauges))
+	for _, g := range gauges {
+		result = append(result, g)
+	}
+	return result
+}
+
+// RegisterGaugeFunc registers a gauge whose value is computed by fn at
+// scrape time, creating it on first use.
+func RegisterGaugeFunc(name string, fn func() float64) *GaugeFunc {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if g, ok := gaugeFuncs[name]; ok {
+		return g
+	}
+
+	g := &GaugeFunc{name: name, fn: fn}
+	gaugeFuncs[name] = g
+	return g
+}
+
+// GaugeFuncs returns a snapshot of all registered computed gauges.
+func GaugeFuncs() []*GaugeFunc {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	result := make([]*GaugeFunc, 0, len(gaugeFuncs))
+	for _, g := range gaugeFuncs {
+		result = append(result, g)
+	}
+	return result
+}
+
+// RegisterHistogram returns the histogram registered under name,
+// creating it with the given buckets on first use.
+func RegisterHistogram(name string, buckets []float64) *Histogram {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if h, ok := histograms[name]; ok {
+		return h
+	}
+
+	h := &Histogram{name: name, buckets: buckets, counts: make([]int64, len(buckets))}
+	histograms[name] = h
+	return h
+}
+
+// Histograms returns a snapshot of all registered histograms.
+func Histograms() []*Histogram {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	result := make([]*Histogram, 0, len(histograms))
+	for _, h := range histograms {
+		result = append(result, h)
+	}
+	return result
+}
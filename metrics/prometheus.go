@@ -0,0 +1,149 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// FormatterPrometheus is the metrics.Config.LogFormatter value that
+// emits the Prometheus text exposition format on every log tick,
+// instead of the default human-readable line.
+const FormatterPrometheus = "prometheus"
+
+// help holds human-readable descriptions for the series AnyCable ships
+// out of the box. A metric registered without an entry here still gets
+// a generic "# HELP" line, since the exposition format requires one per
+// metric.
+var help = map[string]string{
+	"stale_connections_total":           "Total number of WebSocket connections closed by the reaper after missing a pong.",
+	"compressed_bytes_sent":             "Total number of payload bytes written with permessage-deflate compression enabled.",
+	"anycable_goroutines_num":           "Number of goroutines currently running.",
+	"anycable_clients_num":              "Number of currently connected clients.",
+	"anycable_disconnect_queue_size":    "Number of sessions waiting for their disconnect notification to be sent to the RPC server.",
+	"anycable_broadcast_msg_total":      "Total number of broadcast messages published to clients.",
+	"anycable_rpc_call_latency_seconds": "RPC call latency distribution, in seconds.",
+}
+
+func describe(name string) string {
+	if d, ok := help[name]; ok {
+		return d
+	}
+	return name + " metric."
+}
+
+// WritePrometheus serializes all registered counters, gauges and
+// histograms to w in the Prometheus text exposition format
+// (https://prometheus.io/docs/instrumenting/exposition_formats/), so
+// AnyCable can be scraped by a standard Prometheus server without a
+// sidecar.
+func WritePrometheus(w io.Writer) {
+	for _, c := range sortedCounters() {
+		fmt.Fprintf(w, "# HELP %s %s\n", c.Name(), describe(c.Name()))
+		fmt.Fprintf(w, "# TYPE %s counter\n", c.Name())
+		fmt.Fprintf(w, "%s %d\n", c.Name(), c.Value())
+	}
+
+	for _, g := range sortedGauges() {
+		fmt.Fprintf(w, "# HELP %s %s\n", g.Name(), describe(g.Name()))
+		fmt.Fprintf(w, "# TYPE %s gauge\n", g.Name())
+		fmt.Fprintf(w, "%s %s\n", g.Name(), formatFloat(g.Value()))
+	}
+
+	for _, g := range sortedGaugeFuncs() {
+		fmt.Fprintf(w, "# HELP %s %s\n", g.Name(), describe(g.Name()))
+		fmt.Fprintf(w, "# TYPE %s gauge\n", g.Name())
+		fmt.Fprintf(w, "%s %s\n", g.Name(), formatFloat(g.Value()))
+	}
+
+	for _, h := range sortedHistograms() {
+		writeHistogram(w, h)
+	}
+}
+
+// FormatPrometheus returns the same output as WritePrometheus, for
+// callers (like the "prometheus" log formatter) that need a string.
+func FormatPrometheus() string {
+	var buf strings.Builder
+	WritePrometheus(&buf)
+	return buf.String()
+}
+
+// LogLine returns what the periodic metrics log tick should write for
+// the current snapshot, honoring cfg.LogFormatter: the full Prometheus
+// text exposition format when it's FormatterPrometheus, or the default
+// single "name=value" summary line otherwise.
+func LogLine(cfg *Config) string {
+	if cfg.LogFormatter == FormatterPrometheus {
+		return FormatPrometheus()
+	}
+	return defaultLogLine()
+}
+
+// defaultLogLine renders every counter and gauge as a space-separated
+// "name=value" summary, the plain line format logged when no formatter
+// is configured.
+func defaultLogLine() string {
+	var parts []string
+
+	for _, c := range sortedCounters() {
+		parts = append(parts, fmt.Sprintf("%s=%d", c.Name(), c.Value()))
+	}
+
+	for _, g := range sortedGauges() {
+		parts = append(parts, fmt.Sprintf("%s=%s", g.Name(), formatFloat(g.Value())))
+	}
+
+	for _, g := range sortedGaugeFuncs() {
+		parts = append(parts, fmt.Sprintf("%s=%s", g.Name(), formatFloat(g.Value())))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func writeHistogram(w io.Writer, h *Histogram) {
+	buckets, counts, sum, count := h.Snapshot()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", h.Name(), describe(h.Name()))
+	fmt.Fprintf(w, "# TYPE %s histogram\n", h.Name())
+	for i, upperBound := range buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.Name(), formatFloat(upperBound), counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.Name(), count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.Name(), formatFloat(sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.Name(), count)
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedCounters() []*Counter {
+	result := Counters()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
+
+func sortedGauges() []*Gauge {
+	result := Gauges()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
+
+func sortedGaugeFuncs() []*GaugeFunc {
+	result := GaugeFuncs()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
+
+func sortedHistograms() []*Histogram {
+	result := Histograms()
+	sort.Slice(result, func(i, j int) bool { return result[i].Name() < result[j].Name() })
+	return result
+}
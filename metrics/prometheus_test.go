@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatPrometheus(t *testing.T) {
+	c := RegisterCounter("test_prometheus_counter_total")
+	c.Add(5)
+
+	g := RegisterGauge("test_prometheus_gauge")
+	g.Set(2.5)
+
+	h := RegisterHistogram("test_prometheus_histogram_seconds", []float64{0.1, 1})
+	h.Observe(0.05)
+	h.Observe(2)
+
+	out := FormatPrometheus()
+
+	assert.Contains(t, out, "# HELP test_prometheus_counter_total")
+	assert.Contains(t, out, "# TYPE test_prometheus_counter_total counter")
+	assert.Contains(t, out, "test_prometheus_counter_total 5")
+
+	assert.Contains(t, out, "# HELP test_prometheus_gauge")
+	assert.Contains(t, out, "# TYPE test_prometheus_gauge gauge")
+	assert.Contains(t, out, "test_prometheus_gauge 2.5")
+
+	assert.Contains(t, out, "# HELP test_prometheus_histogram_seconds")
+	assert.Contains(t, out, "test_prometheus_histogram_seconds_bucket{le=\"0.1\"} 1")
+	assert.Contains(t, out, "test_prometheus_histogram_seconds_bucket{le=\"1\"} 1")
+	assert.Contains(t, out, "test_prometheus_histogram_seconds_bucket{le=\"+Inf\"} 2")
+	assert.True(t, strings.Contains(out, "test_prometheus_histogram_seconds_count 2"))
+}
+
+func TestLogLine(t *testing.T) {
+	RegisterCounter("test_logline_counter_total").Add(3)
+	RegisterGauge("test_logline_gauge").Set(1.5)
+
+	t.Run("default formatter", func(t *testing.T) {
+		cfg := &Config{}
+		out := LogLine(cfg)
+		assert.Contains(t, out, "test_logline_counter_total=3")
+		assert.Contains(t, out, "test_logline_gauge=1.5")
+		assert.NotContains(t, out, "# HELP")
+	})
+
+	t.Run("prometheus formatter", func(t *testing.T) {
+		cfg := &Config{LogFormatter: FormatterPrometheus}
+		out := LogLine(cfg)
+		assert.Equal(t, FormatPrometheus(), out)
+		assert.Contains(t, out, "# HELP test_logline_counter_total")
+	})
+}
@@ -0,0 +1,30 @@
+package metrics
+
+import "runtime"
+
+// Series AnyCable exposes out of the box, independent of whatever is
+// scraping them (log formatter or the /metrics HTTP endpoint). Other
+// packages update ClientsNum, DisconnectQueueSize, BroadcastMsgTotal
+// and RPCCallLatency as they go about their work.
+var (
+	// GoroutinesNum is recomputed on every scrape, so there's nothing to update.
+	GoroutinesNum = RegisterGaugeFunc("anycable_goroutines_num", func() float64 {
+		return float64(runtime.NumGoroutine())
+	})
+
+	// ClientsNum is the number of currently connected clients.
+	ClientsNum = RegisterGauge("anycable_clients_num")
+
+	// DisconnectQueueSize is the number of sessions waiting for their
+	// disconnect notification to be sent to the RPC server.
+	DisconnectQueueSize = RegisterGauge("anycable_disconnect_queue_size")
+
+	// BroadcastMsgTotal counts broadcast messages published to clients.
+	BroadcastMsgTotal = RegisterCounter("anycable_broadcast_msg_total")
+
+	// RPCCallLatency tracks how long RPC calls (Connect/Command/Disconnect)
+	// take to complete, in seconds.
+	RPCCallLatency = RegisterHistogram("anycable_rpc_call_latency_seconds", []float64{
+		0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5,
+	})
+)
@@ -0,0 +1,74 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec encodes messages Session builds itself (pings, replies) and
+// decodes incoming client frames into the canonical JSON command
+// AnyCable's pipeline expects, so Session's framing logic doesn't need
+// to know whether a client is talking JSON, msgpack, or whatever comes
+// next.
+type Codec interface {
+	Encode(msg interface{}) ([]byte, error)
+	Decode(data []byte) ([]byte, error)
+}
+
+// JSONCodec is the original (and default) AnyCable wire format.
+type JSONCodec struct{}
+
+// Encode implements Codec.
+func (JSONCodec) Encode(msg interface{}) ([]byte, error) {
+	return json.Marshal(msg)
+}
+
+// Decode implements Codec. JSON is already the canonical format, so
+// this is a no-op passthrough.
+func (JSONCodec) Decode(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// MsgpackCodec encodes messages as MessagePack, for clients that
+// negotiate the actioncable-v1-msgpack subprotocol to save on CPU and
+// bandwidth compared to JSON.
+type MsgpackCodec struct{}
+
+// Encode implements Codec.
+func (MsgpackCodec) Encode(msg interface{}) ([]byte, error) {
+	return msgpack.Marshal(msg)
+}
+
+// Decode implements Codec, converting a msgpack-encoded client frame
+// into the canonical JSON the rest of the pipeline understands.
+//
+// msgpack.Unmarshal alone isn't enough to validate a frame: almost any
+// byte is a valid leader for *some* msgpack value (a bare string's
+// first byte, say, decodes cleanly as a fixint), so garbage input
+// would otherwise decode into a nonsense value instead of erroring.
+// Guard against that by requiring the whole payload to be consumed by
+// a single, structured (map) value — a client command is always an
+// object, never a bare scalar.
+func (MsgpackCodec) Decode(data []byte) ([]byte, error) {
+	var v interface{}
+
+	reader := bytes.NewReader(data)
+	dec := msgpack.NewDecoder(reader)
+
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	if reader.Len() > 0 {
+		return nil, fmt.Errorf("msgpack: %d trailing byte(s) after decoded value", reader.Len())
+	}
+
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("msgpack: expected a map, got %T", v)
+	}
+
+	return json.Marshal(v)
+}
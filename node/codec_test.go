@@ -0,0 +1,50 @@
+package node
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateCodec(t *testing.T) {
+	t.Run("msgpack subprotocol", func(t *testing.T) {
+		protocol, codec := NegotiateCodec(ProtocolV1Msgpack)
+		assert.Equal(t, ProtocolV1Msgpack, protocol)
+		assert.IsType(t, MsgpackCodec{}, codec)
+	})
+
+	t.Run("json subprotocol", func(t *testing.T) {
+		protocol, codec := NegotiateCodec(ProtocolV1JSON)
+		assert.Equal(t, ProtocolV1JSON, protocol)
+		assert.IsType(t, JSONCodec{}, codec)
+	})
+
+	t.Run("unknown subprotocol falls back to json", func(t *testing.T) {
+		protocol, codec := NegotiateCodec("")
+		assert.Equal(t, ProtocolV1JSON, protocol)
+		assert.IsType(t, JSONCodec{}, codec)
+	})
+}
+
+func TestJSONCodec_RoundTrip(t *testing.T) {
+	codec := JSONCodec{}
+
+	encoded, err := codec.Encode(&pingMessage{Type: "ping", Message: int64(42)})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"ping","message":42}`, string(encoded))
+
+	decoded, err := codec.Decode(encoded)
+	assert.NoError(t, err)
+	assert.Equal(t, encoded, decoded)
+}
+
+func TestMsgpackCodec_RoundTrip(t *testing.T) {
+	codec := MsgpackCodec{}
+
+	encoded, err := codec.Encode(&pingMessage{Type: "ping", Message: int64(42)})
+	assert.NoError(t, err)
+
+	decoded, err := codec.Decode(encoded)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"type":"ping","message":42}`, string(decoded))
+}
@@ -0,0 +1,63 @@
+package node
+
+import "time"
+
+// Config contains per-Session tunables that control the WebSocket
+// heartbeat and framing behaviour. Operators can override the defaults
+// to trade reaper sensitivity against tolerance for slow clients.
+type Config struct {
+	// PingInterval is how often the server sends a ping frame (seconds).
+	PingInterval int
+	// PongWait is how long the server waits for a pong (or any read
+	// activity) before considering the connection stale (seconds).
+	PongWait int
+	// WriteWait is the deadline for a single write to complete (seconds).
+	WriteWait int
+	// MaxMessageSize is the largest message accepted from a client, in bytes.
+	MaxMessageSize int64
+
+	// Compression enables the permessage-deflate WebSocket extension.
+	Compression bool
+	// CompressionLevel is passed to flate.NewWriter (1-9, or -1 for the default).
+	CompressionLevel int
+	// CompressionThreshold is the minimum payload size (bytes) a frame
+	// must reach before it's compressed; small frames aren't worth it.
+	CompressionThreshold int
+
+	// ShutdownFlushTimeout is how long Close waits for a session's
+	// buffered send queue to drain before giving up and sending the
+	// close frame anyway (seconds).
+	ShutdownFlushTimeout int
+}
+
+// NewConfig returns a Config with the defaults AnyCable has shipped with.
+func NewConfig() Config {
+	return Config{
+		PingInterval:   3,
+		PongWait:       60,
+		WriteWait:      10,
+		MaxMessageSize: 65536,
+
+		Compression:          false,
+		CompressionLevel:     6,
+		CompressionThreshold: 1024,
+
+		ShutdownFlushTimeout: 5,
+	}
+}
+
+func (c *Config) pingInterval() time.Duration {
+	return time.Duration(c.PingInterval) * time.Second
+}
+
+func (c *Config) pongWait() time.Duration {
+	return time.Duration(c.PongWait) * time.Second
+}
+
+func (c *Config) writeWait() time.Duration {
+	return time.Duration(c.WriteWait) * time.Second
+}
+
+func (c *Config) shutdownFlushTimeout() time.Duration {
+	return time.Duration(c.ShutdownFlushTimeout) * time.Second
+}
@@ -1,12 +1,13 @@
 package node
 
 import (
-	"encoding/json"
+	"errors"
+	"net"
 	"sync"
 	"time"
 
 	"github.com/anycable/anycable-go/common"
-	"github.com/anycable/anycable-go/utils"
+	"github.com/anycable/anycable-go/metrics"
 	"github.com/apex/log"
 	"github.com/gorilla/websocket"
 )
@@ -23,11 +24,15 @@ const (
 
 	// CloseGoingAway indicates closing because of server shuts down or client disconnects
 	CloseGoingAway = websocket.CloseGoingAway
-
-	writeWait    = 10 * time.Second
-	pingInterval = 3 * time.Second
 )
 
+// staleConnectionsTotal counts WebSocket connections the reaper killed
+// because no pong (or any read activity) arrived within pongWait.
+var staleConnectionsTotal = metrics.RegisterCounter("stale_connections_total")
+
+// compressedBytesSent counts payload bytes written with permessage-deflate enabled.
+var compressedBytesSent = metrics.RegisterCounter("compressed_bytes_sent")
+
 var (
 	expectedCloseStatuses = []int{
 		websocket.CloseNormalClosure,    // Reserved in case ActionCable fixes its behaviour
@@ -50,10 +55,12 @@ type sentFrame struct {
 	closeReason string
 }
 
-// Session represents active client
+// Session represents an active client. It talks to the client through a
+// pluggable Transport, so WebSocket and SSE (or anything else) connections
+// share the exact same command-handling, ping and shutdown pipeline below.
 type Session struct {
 	node          *Node
-	ws            *websocket.Conn
+	transport     Transport
 	env           *common.SessionEnv
 	subscriptions map[string]bool
 	send          chan sentFrame
@@ -62,34 +69,89 @@ type Session struct {
 	mu            sync.Mutex
 	pingTimer     *time.Timer
 
+	// done is closed exactly once, when Close runs, so write/SendMessages
+	// can tell a shutdown we initiated from the peer just going away.
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// sendDone is closed once SendMessages has returned, i.e. it has
+	// finished writing everything it's going to write to transport,
+	// including the close frame. Callers whose transport's lifetime is
+	// tied to their own goroutine (e.g. an SSE http.Handler, which must
+	// not return before the response writer is done being used) wait on
+	// Done() rather than assuming Close has finished once it returns.
+	sendDone chan struct{}
+
+	// onClose, if set, runs once Close starts tearing the session down.
+	// Transports that keep their own session registry (e.g. SSE) use it
+	// to unregister themselves.
+	onClose func()
+
+	pingInterval         time.Duration
+	writeWait            time.Duration
+	shutdownFlushTimeout time.Duration
+
+	protocol string
+	codec    Codec
+
 	UID         string
 	Identifiers string
 	Log         *log.Entry
 }
 
+// Session is itself a valid Transport: it can be wrapped or handed to
+// code written against the interface (e.g. tests). Write and Read forward
+// straight to the underlying transport; Close tears down the whole session.
+var _ Transport = (*Session)(nil)
+
 type pingMessage struct {
-	Type    string      `json:"type"`
-	Message interface{} `json:"message"`
+	Type    string      `json:"type" msgpack:"type"`
+	Message interface{} `json:"message" msgpack:"message"`
 }
 
-func (p *pingMessage) toJSON() []byte {
-	jsonStr, err := json.Marshal(&p)
-	if err != nil {
-		panic("Failed to build ping JSON 😲")
+// NewSession builds a new Session speaking to the client over a
+// WebSocket connection.
+func NewSession(node *Node, ws *websocket.Conn, url string, headers map[string]string, uid string, config *Config) (*Session, error) {
+	if config == nil {
+		defaults := NewConfig()
+		config = &defaults
 	}
-	return jsonStr
+
+	transport := newWSTransport(ws, config)
+
+	session, err := newSession(node, transport, url, headers, uid, config)
+	if session != nil {
+		session.protocol, session.codec = NegotiateCodec(ws.Subprotocol())
+	}
+
+	return session, err
 }
 
-// NewSession build a new Session struct from ws connetion and http request
-func NewSession(node *Node, ws *websocket.Conn, url string, headers map[string]string, uid string) (*Session, error) {
+// newSession wires up the framing/ping/command-handling plumbing shared
+// by every Transport implementation.
+func newSession(node *Node, transport Transport, url string, headers map[string]string, uid string, config *Config) (*Session, error) {
+	if config == nil {
+		defaults := NewConfig()
+		config = &defaults
+	}
+
 	session := &Session{
 		node:          node,
-		ws:            ws,
+		transport:     transport,
 		env:           common.NewSessionEnv(url, &headers),
 		subscriptions: make(map[string]bool),
 		send:          make(chan sentFrame, 256),
 		closed:        false,
 		connected:     false,
+		done:          make(chan struct{}),
+		sendDone:      make(chan struct{}),
+
+		pingInterval:         config.pingInterval(),
+		writeWait:            config.writeWait(),
+		shutdownFlushTimeout: config.shutdownFlushTimeout(),
+
+		protocol: ProtocolV1JSON,
+		codec:    JSONCodec{},
 	}
 
 	session.UID = uid
@@ -103,7 +165,7 @@ func NewSession(node *Node, ws *websocket.Conn, url string, headers map[string]s
 	err := node.Authenticate(session)
 
 	if err != nil {
-		defer session.Close("Auth Error", CloseInternalServerErr)
+		defer session.Close("Auth Error", CloseInternalServerErr) // nolint:errcheck
 	}
 
 	go session.SendMessages()
@@ -113,25 +175,37 @@ func NewSession(node *Node, ws *websocket.Conn, url string, headers map[string]s
 	return session, err
 }
 
-// SendMessages waits for incoming messages and send them to the client connection
+// SendMessages waits for queued frames and writes them to the transport,
+// in order, until the send channel is closed or a write fails.
 func (s *Session) SendMessages() {
-	defer s.Disconnect("Write Failed", CloseAbnormalClosure)
+	defer close(s.sendDone)
+
+	clean := false
+	defer func() {
+		if !clean {
+			s.Disconnect("Write Failed", CloseAbnormalClosure)
+		}
+	}()
+
 	for {
 		select {
 		case message, ok := <-s.send:
 			if !ok {
+				clean = true
 				return
 			}
 
 			switch message.frameType {
 			case textFrame:
-				err := s.write(message.payload, time.Now().Add(writeWait))
+				err := s.transport.Write(message.payload, time.Now().Add(s.writeWait))
 
 				if err != nil {
+					clean = isExpectedCloseErr(err)
 					return
 				}
 			case closeFrame:
-				utils.CloseWS(s.ws, message.closeCode, message.closeReason)
+				err := s.transport.Close(message.closeReason, message.closeCode)
+				clean = err == nil || isExpectedCloseErr(err)
 				return
 			default:
 				s.Log.Errorf("Unknown frame type: %v", message)
@@ -141,9 +215,24 @@ func (s *Session) SendMessages() {
 	}
 }
 
-// Send data to client connection
-func (s *Session) Send(msg []byte) {
-	s.sendFrame(&sentFrame{frameType: textFrame, payload: msg})
+// isExpectedCloseErr returns true for errors that simply mean "this
+// connection is already shutting down", which SendMessages should treat
+// as a clean exit rather than an abnormal disconnect.
+func isExpectedCloseErr(err error) bool {
+	return errors.Is(err, websocket.ErrCloseSent) || errors.Is(err, net.ErrClosed)
+}
+
+// Send encodes msg with the session's negotiated codec and enqueues it
+// to be written to the client connection.
+func (s *Session) Send(msg interface{}) {
+	payload, err := s.codec.Encode(msg)
+
+	if err != nil {
+		s.Log.Errorf("Failed to encode outgoing message: %v", err)
+		return
+	}
+
+	s.sendFrame(&sentFrame{frameType: textFrame, payload: payload})
 }
 
 func (s *Session) sendClose(reason string, code int) {
@@ -167,7 +256,9 @@ func (s *Session) sendFrame(frame *sentFrame) {
 	default:
 		if s.send != nil {
 			close(s.send)
-			defer s.Disconnect("Write failed", CloseAbnormalClosure)
+			if !s.isShuttingDown() {
+				defer s.Disconnect("Write failed", CloseAbnormalClosure)
+			}
 		}
 
 		s.send = nil
@@ -176,32 +267,55 @@ func (s *Session) sendFrame(frame *sentFrame) {
 	s.mu.Unlock()
 }
 
-func (s *Session) write(message []byte, deadline time.Time) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	s.ws.SetWriteDeadline(deadline)
-
-	w, err := s.ws.NextWriter(websocket.TextMessage)
-
-	if err != nil {
-		return err
+// isShuttingDown returns true once Close has run, so sendFrame's
+// full-buffer path above can tell a shutdown we initiated from a genuine
+// backlog.
+func (s *Session) isShuttingDown() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+		return false
 	}
+}
 
-	w.Write(message)
+// Done returns a channel that's closed once SendMessages has stopped
+// writing to the transport for good (including, if one was enqueued,
+// the close frame). Callers that own the transport's underlying
+// resource for only as long as their own goroutine runs — e.g. an SSE
+// http.Handler, whose http.ResponseWriter is invalid the moment it
+// returns — must wait on this after calling Close, since Close only
+// enqueues the close frame rather than waiting for it to be written.
+func (s *Session) Done() <-chan struct{} {
+	return s.sendDone
+}
 
-	return w.Close()
+// Write implements Transport by handing the payload directly to the
+// underlying connection, bypassing the send queue. Most callers should
+// use Send instead, which preserves frame ordering.
+func (s *Session) Write(msg []byte, deadline time.Time) error {
+	return s.transport.Write(msg, deadline)
 }
 
-// ReadMessages reads messages from ws connection and send them to node
+// Read implements Transport.
+func (s *Session) Read() ([]byte, error) {
+	return s.transport.Read()
+}
+
+// ReadMessages reads messages from the transport, decodes them with the
+// session's negotiated codec, and passes them on to the node.
 func (s *Session) ReadMessages() {
 	for {
-		_, message, err := s.ws.ReadMessage()
+		message, err := s.transport.Read()
 
 		if err != nil {
 			if websocket.IsCloseError(err, expectedCloseStatuses...) {
 				s.Log.Debugf("Websocket closed: %v", err)
 				s.Disconnect("Read closed", CloseNormalClosure)
+			} else if isReadDeadlineExceeded(err) {
+				s.Log.Debugf("Stale connection detected, closing: %v", err)
+				staleConnectionsTotal.Inc()
+				s.Disconnect("Stale connection", CloseGoingAway)
 			} else {
 				s.Log.Debugf("Websocket close error: %v", err)
 				s.Disconnect("Read failed", CloseAbnormalClosure)
@@ -209,10 +323,25 @@ func (s *Session) ReadMessages() {
 			break
 		}
 
-		s.node.HandleCommand(s, message)
+		decoded, err := s.codec.Decode(message)
+
+		if err != nil {
+			s.Log.Errorf("Failed to decode incoming message: %v", err)
+			continue
+		}
+
+		s.node.HandleCommand(s, decoded)
 	}
 }
 
+// isReadDeadlineExceeded returns true iff err comes from the read
+// deadline set up by the transport firing, i.e. no pong (or other read
+// activity) arrived within pongWait.
+func isReadDeadlineExceeded(err error) bool {
+	netErr, ok := err.(net.Error)
+	return ok && netErr.Timeout()
+}
+
 // Disconnect enqueues RPC disconnect request and closes the connection
 func (s *Session) Disconnect(reason string, code int) {
 	s.mu.Lock()
@@ -222,31 +351,72 @@ func (s *Session) Disconnect(reason string, code int) {
 	s.connected = false
 	s.mu.Unlock()
 
-	s.Close(reason, code)
+	s.Close(reason, code) // nolint:errcheck
 }
 
-// Close websocket connection with the specified reason
-func (s *Session) Close(reason string, code int) {
+// Close tears down the session with the specified reason, exactly once.
+func (s *Session) Close(reason string, code int) error {
 	s.mu.Lock()
 
 	if s.closed {
 		s.mu.Unlock()
-		return
+		return nil
 	}
 
 	s.closed = true
 	s.mu.Unlock()
 
+	if s.onClose != nil {
+		s.onClose()
+	}
+
+	s.closeOnce.Do(func() { close(s.done) })
+
+	s.flushSendBuffer()
+
 	s.sendClose(reason, code)
 
 	if s.pingTimer != nil {
 		s.pingTimer.Stop()
 	}
+
+	return nil
+}
+
+// flushSendBuffer gives SendMessages up to shutdownFlushTimeout to write
+// out anything already queued, so broadcasts already in flight reach the
+// client before the close frame rather than being dropped on the floor.
+func (s *Session) flushSendBuffer() {
+	s.mu.Lock()
+	ch := s.send
+	s.mu.Unlock()
+
+	if len(ch) == 0 {
+		return
+	}
+
+	deadline := time.NewTimer(s.shutdownFlushTimeout)
+	defer deadline.Stop()
+
+	ticker := time.NewTicker(5 * time.Millisecond)
+	defer ticker.Stop()
+
+	for len(ch) > 0 {
+		select {
+		case <-deadline.C:
+			return
+		case <-ticker.C:
+		}
+	}
 }
 
 func (s *Session) sendPing() {
-	deadline := time.Now().Add(pingInterval / 2)
-	err := s.write(newPingMessage(), deadline)
+	payload, err := s.newPingMessage()
+
+	if err == nil {
+		deadline := time.Now().Add(s.writeWait)
+		err = s.transport.Write(payload, deadline)
+	}
 
 	if err == nil {
 		s.addPing()
@@ -263,9 +433,9 @@ func (s *Session) addPing() {
 		return
 	}
 
-	s.pingTimer = time.AfterFunc(pingInterval, s.sendPing)
+	s.pingTimer = time.AfterFunc(s.pingInterval, s.sendPing)
 }
 
-func newPingMessage() []byte {
-	return (&pingMessage{Type: "ping", Message: time.Now().Unix()}).toJSON()
+func (s *Session) newPingMessage() ([]byte, error) {
+	return s.codec.Encode(&pingMessage{Type: "ping", Message: time.Now().Unix()})
 }
@@ -0,0 +1,93 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newBenchConn spins up a short-lived WebSocket server and returns the
+// server-side connection so we can benchmark wsTransport.Write directly,
+// with or without compression enabled.
+func newBenchConn(b *testing.B, compression bool) (*websocket.Conn, func()) {
+	b.Helper()
+
+	upgrader := websocket.Upgrader{EnableCompression: compression}
+
+	serverConnCh := make(chan *websocket.Conn, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			b.Fatalf("upgrade failed: %v", err)
+		}
+		serverConnCh <- conn
+	}))
+
+	dialer := websocket.Dialer{EnableCompression: compression}
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+
+	clientConn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		b.Fatalf("dial failed: %v", err)
+	}
+
+	serverConn := <-serverConnCh
+
+	// Drain client reads so the server's writes don't block on a full socket buffer.
+	go func() {
+		for {
+			if _, _, err := clientConn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	return serverConn, func() {
+		clientConn.Close()
+		serverConn.Close()
+		srv.Close()
+	}
+}
+
+func benchmarkWrite(b *testing.B, compression bool, payloadSize int) {
+	ws, cleanup := newBenchConn(b, compression)
+	defer cleanup()
+
+	config := NewConfig()
+	config.Compression = compression
+	config.CompressionLevel = 6
+	config.CompressionThreshold = 1024
+
+	transport := newWSTransport(ws, &config)
+
+	payload := make([]byte, payloadSize)
+	for i := range payload {
+		payload[i] = 'a'
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := transport.Write(payload, time.Now().Add(10*time.Second)); err != nil {
+			b.Fatalf("write failed: %v", err)
+		}
+	}
+}
+
+func BenchmarkSessionWrite_Uncompressed_Small(b *testing.B) {
+	benchmarkWrite(b, false, 256)
+}
+
+func BenchmarkSessionWrite_Uncompressed_Large(b *testing.B) {
+	benchmarkWrite(b, false, 64*1024)
+}
+
+func BenchmarkSessionWrite_Compressed_Large(b *testing.B) {
+	benchmarkWrite(b, true, 64*1024)
+}
@@ -0,0 +1,35 @@
+package node
+
+import (
+	"net"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsExpectedCloseErr(t *testing.T) {
+	assert.True(t, isExpectedCloseErr(websocket.ErrCloseSent))
+	assert.True(t, isExpectedCloseErr(net.ErrClosed))
+	assert.False(t, isExpectedCloseErr(nil) || isExpectedCloseErr(assert.AnError))
+}
+
+func TestSession_CloseIsIdempotent(t *testing.T) {
+	s := &Session{
+		send: make(chan sentFrame, 2),
+		done: make(chan struct{}),
+	}
+
+	assert.False(t, s.isShuttingDown())
+
+	assert.NotPanics(t, func() {
+		s.Close("first", CloseNormalClosure)
+		s.Close("second", CloseNormalClosure)
+	})
+
+	assert.True(t, s.isShuttingDown())
+
+	// The second Close call must be a no-op: only the first call's close
+	// frame should ever have reached the send queue.
+	assert.Equal(t, 1, len(s.send))
+}
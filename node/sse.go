@@ -0,0 +1,275 @@
+package node
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// SSEPath is the default route SSE clients connect to in order to open
+// the event stream.
+const SSEPath = "/events"
+
+// sseEntry pairs a live SSE session with the secret minted for it at
+// connect time, so SSECommandHandler can authenticate POSTed commands
+// instead of trusting the caller-supplied (and guessable) uid alone.
+type sseEntry struct {
+	session *Session
+	secret  string
+}
+
+// sseRegistry tracks live SSE sessions by UID so the companion command
+// endpoint can route incoming RPCs to the right stream.
+var sseRegistry sync.Map // map[string]*sseEntry
+
+var (
+	errSSEClosed          = fmt.Errorf("sse: connection closed")
+	errSSEReadUnsupported = fmt.Errorf("sse: transport is write-only, commands are submitted via POST")
+	errSSEUnauthorized    = fmt.Errorf("sse: invalid or missing session token")
+	errSSEMalformed       = fmt.Errorf("sse: malformed command payload")
+)
+
+// sseSessionToken is pushed to the client as the first message on a
+// freshly opened stream. The client must echo Token back on every
+// subsequent SSECommandHandler request.
+type sseSessionToken struct {
+	Type  string `json:"type" msgpack:"type"`
+	Token string `json:"token" msgpack:"token"`
+}
+
+// newSSESecret mints a random per-session token, unrelated to the
+// client-chosen uid, so a guessed or reused uid alone can't authorize commands.
+func newSSESecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// validSSESecret compares in constant time so the command endpoint
+// doesn't leak timing information about a guessed token.
+func validSSESecret(want, got string) bool {
+	if want == "" || got == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+// sseTransport adapts an open http.ResponseWriter/Flusher pair to the
+// Transport interface. SSE only carries server->client data: clients
+// submit commands out-of-band via SSECommandHandler, so Read always
+// returns an error.
+type sseTransport struct {
+	w       http.ResponseWriter
+	flusher http.Flusher
+	mu      sync.Mutex
+	closed  bool
+}
+
+func newSSETransport(w http.ResponseWriter) (*sseTransport, error) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return nil, fmt.Errorf("streaming unsupported by response writer")
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+
+	return &sseTransport{w: w, flusher: flusher}, nil
+}
+
+// Write implements Transport. The deadline is not enforced: the write
+// blocks for as long as the underlying response writer does.
+func (t *sseTransport) Write(msg []byte, deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return errSSEClosed
+	}
+
+	if _, err := fmt.Fprintf(t.w, "data: %s\n\n", msg); err != nil {
+		return err
+	}
+
+	t.flusher.Flush()
+	return nil
+}
+
+// Read implements Transport.
+func (t *sseTransport) Read() ([]byte, error) {
+	return nil, errSSEReadUnsupported
+}
+
+// Close implements Transport.
+func (t *sseTransport) Close(reason string, code int) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return nil
+	}
+	t.closed = true
+
+	fmt.Fprintf(t.w, "event: close\ndata: %s\n\n", reason) // nolint:errcheck
+	t.flusher.Flush()
+	return nil
+}
+
+var _ Transport = (*sseTransport)(nil)
+
+// NewSSESession builds a Session backed by an open HTTP response writer,
+// mints a per-session secret and registers the pair so commands posted
+// to SSECommandHandler can be authenticated and routed to it. The secret
+// is pushed to the client as the first message on the stream; the client
+// must echo it back on every subsequent command POST.
+func NewSSESession(node *Node, w http.ResponseWriter, url string, headers map[string]string, uid string, config *Config) (*Session, error) {
+	transport, err := newSSETransport(w)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := newSession(node, transport, url, headers, uid, config)
+	if session == nil {
+		return nil, err
+	}
+
+	if err != nil {
+		// newSession already ran Close synchronously on this path (and
+		// onClose, had it been set, with it), so there's nothing to
+		// register: doing so anyway would leak a dead session in
+		// sseRegistry forever.
+		return session, err
+	}
+
+	secret, err := newSSESecret()
+	if err != nil {
+		session.Close("Internal Error", CloseInternalServerErr) // nolint:errcheck
+		return session, err
+	}
+
+	entry := &sseEntry{session: session, secret: secret}
+
+	if _, loaded := sseRegistry.LoadOrStore(session.UID, entry); loaded {
+		// Someone's already registered under this uid — a reconnect
+		// racing its predecessor's Close, or two clients sharing a
+		// uid. Don't clobber the live entry: its onClose deletes by
+		// uid, so overwriting it here would later delete *this*
+		// entry out from under the still-live session that owns it.
+		session.Close("Internal Error", CloseInternalServerErr) // nolint:errcheck
+		return session, fmt.Errorf("sse: uid %q is already in use", session.UID)
+	}
+
+	session.onClose = func() {
+		sseRegistry.CompareAndDelete(session.UID, entry)
+	}
+
+	session.Send(&sseSessionToken{Type: "session_token", Token: secret})
+
+	return session, nil
+}
+
+// HandleSSECommand looks up the session registered for uid, checks that
+// secret matches the token minted for it at connect time, and feeds the
+// command into its node pipeline, exactly as ReadMessages does for
+// WebSocket sessions.
+func HandleSSECommand(uid, secret string, message []byte) error {
+	v, ok := sseRegistry.Load(uid)
+	if !ok {
+		return fmt.Errorf("unknown sse session: %s", uid)
+	}
+
+	entry := v.(*sseEntry)
+
+	if !validSSESecret(entry.secret, secret) {
+		return errSSEUnauthorized
+	}
+
+	decoded, err := entry.session.codec.Decode(message)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errSSEMalformed, err)
+	}
+
+	entry.session.node.HandleCommand(entry.session, decoded)
+	return nil
+}
+
+// SSEHandler opens the event stream for a new client.
+func SSEHandler(node *Node, config *Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		headers := map[string]string{}
+		for k := range r.Header {
+			headers[k] = r.Header.Get(k)
+		}
+
+		uid := r.URL.Query().Get("uid")
+		if uid == "" {
+			uid = fmt.Sprintf("sse-%d", time.Now().UnixNano())
+		}
+
+		session, err := NewSSESession(node, w, r.URL.String(), headers, uid, config)
+		if err != nil {
+			// Close has already been triggered (synchronously, by
+			// NewSSESession) on this path, but it only enqueues the
+			// close frame. SendMessages writes it asynchronously, and
+			// the ResponseWriter it writes to becomes invalid the
+			// moment this handler returns, so we must wait for it to
+			// actually finish before touching w again or returning.
+			if session != nil {
+				<-session.Done()
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		<-r.Context().Done()
+		session.Close("Connection closed", CloseGoingAway) // nolint:errcheck
+		<-session.Done()
+	}
+}
+
+// SSECommandHandler accepts command RPCs (subscribe/unsubscribe/perform)
+// for an already-open SSE stream identified by its uid and feeds them
+// into the usual HandleCommand pipeline. Callers must present the
+// session token pushed over the stream at connect time, either via the
+// X-Session-Token header or a token query param; without it the uid
+// alone (client-chosen, and potentially guessable) grants nothing.
+func SSECommandHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		uid := r.URL.Query().Get("uid")
+		if uid == "" {
+			http.Error(w, "missing uid", http.StatusBadRequest)
+			return
+		}
+
+		secret := r.Header.Get("X-Session-Token")
+		if secret == "" {
+			secret = r.URL.Query().Get("token")
+		}
+
+		var raw json.RawMessage
+		if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		switch err := HandleSSECommand(uid, secret, raw); {
+		case err == nil:
+			w.WriteHeader(http.StatusNoContent)
+		case errors.Is(err, errSSEUnauthorized):
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+		case errors.Is(err, errSSEMalformed):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noFlushWriter is an http.ResponseWriter that doesn't implement
+// http.Flusher, to exercise newSSETransport's streaming-unsupported path.
+type noFlushWriter struct {
+	http.ResponseWriter
+}
+
+func TestNewSSETransport_RequiresFlusher(t *testing.T) {
+	_, err := newSSETransport(noFlushWriter{httptest.NewRecorder()})
+	assert.Error(t, err)
+}
+
+func TestSSETransport_WriteAndClose(t *testing.T) {
+	w := httptest.NewRecorder()
+	transport, err := newSSETransport(w)
+	assert.NoError(t, err)
+
+	assert.NoError(t, transport.Write([]byte(`{"type":"ping"}`), time.Now()))
+	assert.Contains(t, w.Body.String(), "data: {\"type\":\"ping\"}\n\n")
+
+	_, err = transport.Read()
+	assert.Error(t, err)
+
+	assert.NoError(t, transport.Close("bye", CloseNormalClosure))
+	assert.Contains(t, w.Body.String(), "event: close\ndata: bye\n\n")
+
+	// A second Close, and any Write after Close, must be no-ops/errors
+	// rather than panicking on the already-finished response.
+	assert.NoError(t, transport.Close("bye again", CloseNormalClosure))
+	assert.ErrorIs(t, transport.Write([]byte("late"), time.Now()), errSSEClosed)
+}
+
+func TestSSESecret(t *testing.T) {
+	a, err := newSSESecret()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, a)
+
+	b, err := newSSESecret()
+	assert.NoError(t, err)
+	assert.NotEqual(t, a, b)
+
+	assert.True(t, validSSESecret(a, a))
+	assert.False(t, validSSESecret(a, b))
+	assert.False(t, validSSESecret("", ""))
+	assert.False(t, validSSESecret(a, ""))
+}
+
+func TestHandleSSECommand_Authentication(t *testing.T) {
+	t.Run("unknown uid", func(t *testing.T) {
+		err := HandleSSECommand("does-not-exist", "whatever", []byte(`{}`))
+		assert.Error(t, err)
+	})
+
+	t.Run("missing or wrong secret is rejected", func(t *testing.T) {
+		session := &Session{codec: JSONCodec{}}
+		sseRegistry.Store("uid-1", &sseEntry{session: session, secret: "correct-secret"})
+		defer sseRegistry.Delete("uid-1")
+
+		assert.Equal(t, errSSEUnauthorized, HandleSSECommand("uid-1", "", []byte(`{}`)))
+		assert.Equal(t, errSSEUnauthorized, HandleSSECommand("uid-1", "guessed", []byte(`{}`)))
+	})
+
+	t.Run("malformed payload is distinguished from an unknown uid", func(t *testing.T) {
+		// JSONCodec.Decode is a passthrough that never errors, so use
+		// MsgpackCodec to exercise a real Decode failure.
+		session := &Session{codec: MsgpackCodec{}}
+		sseRegistry.Store("uid-2", &sseEntry{session: session, secret: "correct-secret"})
+		defer sseRegistry.Delete("uid-2")
+
+		err := HandleSSECommand("uid-2", "correct-secret", []byte("not msgpack"))
+		assert.ErrorIs(t, err, errSSEMalformed)
+	})
+}
+
+func TestSSECommandHandler_StatusCodes(t *testing.T) {
+	// Valid JSON, but not valid msgpack: triggers a Decode failure
+	// (rather than an unknown-uid or auth failure) once it reaches
+	// entry.session.codec.Decode.
+	session := &Session{codec: MsgpackCodec{}}
+	sseRegistry.Store("uid-3", &sseEntry{session: session, secret: "correct-secret"})
+	defer sseRegistry.Delete("uid-3")
+
+	handler := SSECommandHandler()
+
+	post := func(uid, token string, body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/events/command?uid="+uid+"&token="+token, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusBadRequest, post("uid-3", "correct-secret", `{"not":"msgpack"}`))
+	assert.Equal(t, http.StatusUnauthorized, post("uid-3", "wrong-token", "{}"))
+	assert.Equal(t, http.StatusNotFound, post("no-such-uid", "whatever", "{}"))
+}
+
+// blockingTransport lets SendMessages' Close call be held open under test
+// control, so Done() closing can be distinguished from Close() returning.
+type blockingTransport struct {
+	unblock chan struct{}
+}
+
+func (t *blockingTransport) Write([]byte, time.Time) error { return nil }
+func (t *blockingTransport) Read() ([]byte, error)         { return nil, errSSEReadUnsupported }
+func (t *blockingTransport) Close(string, int) error {
+	<-t.unblock
+	return nil
+}
+
+func TestSession_DoneWaitsForSendMessagesToFinish(t *testing.T) {
+	transport := &blockingTransport{unblock: make(chan struct{})}
+	s := &Session{
+		transport: transport,
+		send:      make(chan sentFrame, 4),
+		done:      make(chan struct{}),
+		sendDone:  make(chan struct{}),
+		codec:     JSONCodec{},
+	}
+
+	go s.SendMessages()
+
+	// Close only enqueues the close frame; it must return long before
+	// the transport's Close call (held open by blockingTransport) does.
+	s.Close("bye", CloseNormalClosure) // nolint:errcheck
+
+	select {
+	case <-s.Done():
+		t.Fatal("Done fired before SendMessages actually finished writing")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(transport.unblock)
+
+	select {
+	case <-s.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Done never fired once SendMessages finished")
+	}
+}
+
+// TestSSEHandler_WaitsForWriterBeforeReturning drives SSEHandler over a
+// real httptest.Server and repeatedly cancels the request almost
+// immediately after connecting. Before Done() existed, SSEHandler
+// returned as soon as Close enqueued the close frame, racing (under
+// go test -race) or crashing the whole process (without it) when
+// SendMessages wrote to the now-recycled response writer afterwards.
+func TestSSEHandler_WaitsForWriterBeforeReturning(t *testing.T) {
+	node := NewMockNode()
+	config := NewConfig()
+
+	srv := httptest.NewServer(SSEHandler(&node, &config))
+	defer srv.Close()
+
+	for i := 0; i < 20; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+"?uid=race-"+strconv.Itoa(i), nil)
+		assert.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+	}
+}
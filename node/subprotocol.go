@@ -0,0 +1,27 @@
+package node
+
+const (
+	// ProtocolV1JSON is the original, and still default, AnyCable wire format.
+	ProtocolV1JSON = "actioncable-v1-json"
+	// ProtocolV1Msgpack trades JSON's readability for a smaller, faster
+	// to (de)serialize wire format.
+	ProtocolV1Msgpack = "actioncable-v1-msgpack"
+	// ProtocolV1Protobuf is reserved for a future protobuf codec; until
+	// one ships, negotiating it falls back to JSON.
+	ProtocolV1Protobuf = "actioncable-v1-protobuf"
+)
+
+// SupportedProtocols lists the subprotocols advertised to clients during
+// the WebSocket handshake, in priority order.
+var SupportedProtocols = []string{ProtocolV1Msgpack, ProtocolV1JSON}
+
+// NegotiateCodec picks the Codec matching the subprotocol the client's
+// upgrade request negotiated, defaulting to JSON when none matched.
+func NegotiateCodec(subprotocol string) (string, Codec) {
+	switch subprotocol {
+	case ProtocolV1Msgpack:
+		return ProtocolV1Msgpack, MsgpackCodec{}
+	default:
+		return ProtocolV1JSON, JSONCodec{}
+	}
+}
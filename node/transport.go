@@ -0,0 +1,16 @@
+package node
+
+import "time"
+
+// Transport is the minimal set of operations a Session needs from its
+// underlying wire connection. It lets alternative protocols (e.g. SSE)
+// plug into the same command-handling pipeline that WebSocket sessions
+// use, without Session having to know which one it's talking to.
+type Transport interface {
+	// Write sends a single message frame to the client before the given deadline.
+	Write(msg []byte, deadline time.Time) error
+	// Read blocks until a single message frame arrives from the client.
+	Read() (msg []byte, err error)
+	// Close terminates the underlying connection with the given reason and close code.
+	Close(reason string, code int) error
+}
@@ -0,0 +1,13 @@
+package node
+
+import "github.com/gorilla/websocket"
+
+// NewUpgrader builds the websocket.Upgrader used to accept incoming
+// connections, negotiating the permessage-deflate extension when
+// compression is enabled in config.
+func NewUpgrader(config *Config) *websocket.Upgrader {
+	return &websocket.Upgrader{
+		EnableCompression: config.Compression,
+		Subprotocols:      SupportedProtocols,
+	}
+}
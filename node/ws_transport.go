@@ -0,0 +1,88 @@
+package node
+
+import (
+	"sync"
+	"time"
+
+	"github.com/anycable/anycable-go/utils"
+	"github.com/gorilla/websocket"
+)
+
+// wsTransport adapts a gorilla *websocket.Conn to the Transport
+// interface: it owns framing, permessage-deflate negotiation, and the
+// read deadline/limit/pong-handler housekeeping WebSocket connections need.
+type wsTransport struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+
+	compression          bool
+	compressionThreshold int
+}
+
+// newWSTransport wraps conn, applying config's compression and
+// heartbeat settings.
+func newWSTransport(conn *websocket.Conn, config *Config) *wsTransport {
+	t := &wsTransport{
+		conn:                 conn,
+		compression:          config.Compression,
+		compressionThreshold: config.CompressionThreshold,
+	}
+
+	if config.Compression {
+		conn.SetCompressionLevel(config.CompressionLevel)
+	}
+
+	conn.SetReadLimit(config.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(config.pongWait())) // nolint:errcheck
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(config.pongWait()))
+	})
+
+	return t
+}
+
+// Write implements Transport.
+func (t *wsTransport) Write(message []byte, deadline time.Time) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.conn.SetWriteDeadline(deadline) // nolint:errcheck
+
+	compress := t.compression && len(message) >= t.compressionThreshold
+	if t.compression {
+		t.conn.EnableWriteCompression(compress)
+	}
+
+	w, err := t.conn.NextWriter(websocket.TextMessage)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := w.Write(message); err != nil {
+		return err
+	}
+
+	if err := w.Close(); err != nil {
+		return err
+	}
+
+	if compress {
+		compressedBytesSent.Add(int64(len(message)))
+	}
+
+	return nil
+}
+
+// Read implements Transport.
+func (t *wsTransport) Read() ([]byte, error) {
+	_, message, err := t.conn.ReadMessage()
+	return message, err
+}
+
+// Close implements Transport.
+func (t *wsTransport) Close(reason string, code int) error {
+	return utils.CloseWS(t.conn, code, reason)
+}
+
+var _ Transport = (*wsTransport)(nil)
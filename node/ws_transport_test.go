@@ -0,0 +1,95 @@
+package node
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeTimeoutErr struct{}
+
+func (fakeTimeoutErr) Error() string   { return "i/o timeout" }
+func (fakeTimeoutErr) Timeout() bool   { return true }
+func (fakeTimeoutErr) Temporary() bool { return true }
+
+func TestIsReadDeadlineExceeded(t *testing.T) {
+	assert.True(t, isReadDeadlineExceeded(fakeTimeoutErr{}))
+	assert.False(t, isReadDeadlineExceeded(assert.AnError))
+	assert.False(t, isReadDeadlineExceeded(net.ErrClosed))
+}
+
+// newWSConnPair spins up a short-lived WebSocket server and returns both
+// ends of the connection, mirroring newBenchConn in session_bench_test.go.
+func newWSConnPair(t *testing.T) (serverConn, clientConn *websocket.Conn, cleanup func()) {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{}
+	serverConnCh := make(chan *websocket.Conn, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Fatalf("upgrade failed: %v", err)
+		}
+		serverConnCh <- conn
+	}))
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http")
+	clientConn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+
+	serverConn = <-serverConnCh
+
+	return serverConn, clientConn, func() {
+		clientConn.Close()
+		serverConn.Close()
+		srv.Close()
+	}
+}
+
+func TestNewWSTransport_ReadDeadlineFiresWithoutPong(t *testing.T) {
+	serverConn, _, cleanup := newWSConnPair(t)
+	defer cleanup()
+
+	config := NewConfig()
+	config.PongWait = 1 // seconds
+
+	newWSTransport(serverConn, &config)
+
+	// No pong arrives: the deadline set at construction time should fire.
+	_, _, err := serverConn.ReadMessage()
+	assert.True(t, isReadDeadlineExceeded(err), "expected a read-deadline timeout, got %v", err)
+}
+
+func TestNewWSTransport_PongHandlerResetsDeadline(t *testing.T) {
+	serverConn, clientConn, cleanup := newWSConnPair(t)
+	defer cleanup()
+
+	config := NewConfig()
+	config.PongWait = 1 // seconds
+
+	start := time.Now()
+	newWSTransport(serverConn, &config)
+
+	go func() {
+		// Arrives well before the initial PongWait deadline and should
+		// push it out by another PongWait from here.
+		time.Sleep(700 * time.Millisecond)
+		clientConn.WriteMessage(websocket.PongMessage, nil) // nolint:errcheck
+	}()
+
+	_, _, err := serverConn.ReadMessage()
+	assert.True(t, isReadDeadlineExceeded(err))
+
+	// Had the pong not reset the deadline, this would fire around
+	// PongWait (1s) after start; the reset pushes it out to ~1.7s.
+	assert.Greater(t, time.Since(start), 1200*time.Millisecond)
+}